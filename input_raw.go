@@ -54,7 +54,13 @@ func (i *RAWInput) listen(address string) {
 		// Receiving TCPMessage object
 		m := listener.Receive()
 
-		i.data <- m.Bytes()
+		payloadType := raw.ResponsePayload
+		if m.IsIncoming {
+			payloadType = raw.RequestPayload
+		}
+
+		header := raw.PayloadHeader(payloadType, m.UUID, m.Start.UnixNano())
+		i.data <- append(header, m.Bytes()...)
 	}
 }
 
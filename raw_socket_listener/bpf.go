@@ -0,0 +1,73 @@
+package raw_socket
+
+import "golang.org/x/net/bpf"
+
+// defaultBPF mirrors most of isIncomingDataPacket's userspace filtering in
+// the kernel: IPv4/TCP only, port == t.port on either side (skipped when
+// t.port <= 0), and TCP payload length > 0, which drops SYN/FIN/ACK-only
+// packets before they reach Go. 1-byte keepalives still pass the kernel
+// filter; isHeartbeatPackage continues to catch those in userspace.
+//
+// The two checks that can fail ("not TCP" and "dest port mismatch") jump
+// forward to the single reject instruction at the end of the program; the
+// jump distance depends on how many instructions follow (which varies with
+// whether a port check is present), so it's patched in once the full
+// program is assembled rather than hardcoded.
+func (t *Listener) defaultBPF() []bpf.Instruction {
+	prog := []bpf.Instruction{
+		// Reject anything that isn't TCP.
+		bpf.LoadAbsolute{Off: 9, Size: 1},
+	}
+	protoJump := len(prog)
+	prog = append(prog, bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: 6})
+
+	// X = IP header length (IHL * 4).
+	prog = append(prog, bpf.LoadMemShift{Off: 0})
+
+	var portJump int
+	hasPortCheck := t.port > 0
+	if hasPortCheck {
+		port := uint32(t.port)
+
+		prog = append(prog,
+			// Source port.
+			bpf.LoadIndirect{Off: 0, Size: 2},
+			bpf.JumpIf{Cond: bpf.JumpEqual, Val: port, SkipTrue: 2},
+
+			// Destination port.
+			bpf.LoadIndirect{Off: 2, Size: 2},
+		)
+		portJump = len(prog)
+		prog = append(prog, bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: port})
+	}
+
+	prog = append(prog,
+		// A = IP total length - IP header length (X still holds IHL).
+		bpf.LoadAbsolute{Off: 2, Size: 2},
+		bpf.ALUOpX{Op: bpf.ALUOpSub},
+		bpf.StoreScratch{Src: bpf.RegA, N: 0},
+
+		// A = TCP header length (data offset nibble -> bytes), X = same.
+		bpf.LoadIndirect{Off: 12, Size: 1},
+		bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0xf0},
+		bpf.ALUOpConstant{Op: bpf.ALUOpShiftRight, Val: 2}, // (x&0xf0)>>4*4 == (x&0xf0)>>2
+		bpf.TAX{},
+
+		// A = TCP payload length = (total-IHL) - TCP-header-len.
+		bpf.LoadScratch{Dst: bpf.RegA, N: 0},
+		bpf.ALUOpX{Op: bpf.ALUOpSub},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0, SkipTrue: 1},
+
+		bpf.RetConstant{Val: 0x40000}, // accept, capped at 256KiB
+	)
+
+	reject := len(prog)
+	prog = append(prog, bpf.RetConstant{Val: 0})
+
+	prog[protoJump] = bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: 6, SkipTrue: uint8(reject - protoJump - 1)}
+	if hasPortCheck {
+		prog[portJump] = bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: uint32(t.port), SkipTrue: uint8(reject - portJump - 1)}
+	}
+
+	return prog
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package raw_socket
+
+import "golang.org/x/net/bpf"
+
+// attachBPF is a no-op outside Linux: there's no portable SO_ATTACH_FILTER
+// equivalent, so kernel-side packet filtering is Linux-only and every
+// platform relies on isIncomingDataPacket's userspace filtering instead.
+func attachBPF(fd int, prog []bpf.Instruction) error {
+	return nil
+}
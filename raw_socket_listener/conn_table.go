@@ -0,0 +1,88 @@
+package raw_socket
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// connIdleTimeout is how long a connection can go without a packet before
+// connTable forgets it, same as letting a TCPMessage expire via MSG_EXPIRE
+// but scoped to connection-level bookkeeping rather than one message.
+const connIdleTimeout = 2 * time.Minute
+
+// connKey identifies one direction of a TCP connection.
+type connKey struct {
+	srcIP   string
+	srcPort uint16
+	dstIP   string
+	dstPort uint16
+}
+
+func (k connKey) String() string {
+	return k.srcIP + ":" + strconv.Itoa(int(k.srcPort)) + "-" + k.dstIP + ":" + strconv.Itoa(int(k.dstPort))
+}
+
+// connState is the per-connection bookkeeping connTable keeps so packets
+// can be placed at their absolute position in the stream instead of the
+// wrapping, per-packet Seq.
+type connState struct {
+	isn      uint32 // Seq of the first packet seen on this connection
+	lastSeen time.Time
+}
+
+// connTable tracks connState per 5-tuple, so TCPMessage can order and
+// dedupe packets by absolute stream offset rather than raw Seq. Entries
+// are garbage collected when a FIN/RST is seen, or opportunistically
+// (from Offset) after connIdleTimeout of inactivity.
+type connTable struct {
+	mu     sync.Mutex
+	conns  map[connKey]*connState
+	lastGC time.Time
+}
+
+func newConnTable() *connTable {
+	return &connTable{conns: make(map[connKey]*connState), lastGC: time.Now()}
+}
+
+// Offset returns packet's position in its connection's byte stream and
+// records the connection as seen. Callers must call this once, in packet
+// order, per accepted packet.
+func (c *connTable) Offset(key connKey, packet *TCPPacket) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state, ok := c.conns[key]
+	if !ok {
+		state = &connState{isn: packet.Seq}
+		c.conns[key] = state
+	}
+	state.lastSeen = time.Now()
+
+	offset := uint64(packet.Seq - state.isn) // uint32 wraparound, handled by the subtraction
+
+	if packet.Flags&(TCP_FIN|TCP_RST) != 0 {
+		delete(c.conns, key)
+	}
+
+	if time.Since(c.lastGC) > connIdleTimeout {
+		c.gc()
+	}
+
+	return offset
+}
+
+// gc forgets connections that have gone quiet for connIdleTimeout. Called
+// from Offset (mu already held) rather than a background goroutine, so a
+// connTable - and its owning Listener - don't leak a goroutine+timer for
+// the life of the process.
+func (c *connTable) gc() {
+	c.lastGC = time.Now()
+	deadline := c.lastGC.Add(-connIdleTimeout)
+
+	for key, state := range c.conns {
+		if state.lastSeen.Before(deadline) {
+			delete(c.conns, key)
+		}
+	}
+}
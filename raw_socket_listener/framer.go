@@ -0,0 +1,72 @@
+package raw_socket
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// Protocol selects how a Listener decides a TCPMessage is complete.
+type Protocol int
+
+const (
+	// ProtocolHTTP1 frames messages by parsing HTTP/1.x request/response
+	// lines, headers, and Content-Length/chunked bodies, falling back to
+	// MSG_EXPIRE only for non-HTTP or malformed streams.
+	ProtocolHTTP1 Protocol = iota
+
+	// ProtocolRaw preserves the original behavior: a message is complete
+	// once no packet has arrived for MSG_EXPIRE.
+	ProtocolRaw
+)
+
+// frameHTTP1 attempts to parse buf as a single HTTP/1.x request or
+// response, honouring Content-Length and chunked Transfer-Encoding
+// (including trailers). n is the number of leading bytes of buf that
+// belong to the message.
+//
+// ok is true once a complete message has been framed. malformed is true
+// if buf can never be parsed as HTTP/1.x, in which case the caller should
+// fall back to the MSG_EXPIRE timer instead of retrying on every packet.
+func frameHTTP1(buf []byte) (n int, ok bool, malformed bool) {
+	if n, ok, malformed = frameHTTP1Message(buf, false); !malformed {
+		return n, ok, malformed
+	}
+
+	return frameHTTP1Message(buf, true)
+}
+
+func frameHTTP1Message(buf []byte, response bool) (n int, ok bool, malformed bool) {
+	br := bytes.NewReader(buf)
+	r := bufio.NewReader(br)
+
+	var body io.ReadCloser
+	if response {
+		resp, err := http.ReadResponse(r, nil)
+		if err != nil {
+			return 0, false, isMalformed(err)
+		}
+		body = resp.Body
+	} else {
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			return 0, false, isMalformed(err)
+		}
+		body = req.Body
+	}
+
+	if _, err := io.Copy(ioutil.Discard, body); err != nil {
+		// Incomplete Content-Length/chunked body: wait for more packets.
+		return 0, false, false
+	}
+
+	return len(buf) - br.Len() - r.Buffered(), true, false
+}
+
+// isMalformed distinguishes "not enough bytes yet" from "this will never
+// be a valid HTTP/1.x message".
+func isMalformed(err error) bool {
+	return err != io.EOF && err != io.ErrUnexpectedEOF
+}
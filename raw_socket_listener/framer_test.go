@@ -0,0 +1,112 @@
+package raw_socket
+
+import "testing"
+
+func TestFrameHTTP1Request(t *testing.T) {
+	buf := []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+
+	n, ok, malformed := frameHTTP1(buf)
+	if malformed {
+		t.Fatalf("frameHTTP1 reported malformed for a valid request")
+	}
+	if !ok {
+		t.Fatalf("frameHTTP1 did not frame a complete request")
+	}
+	if n != len(buf) {
+		t.Fatalf("n = %d, want %d (whole buffer)", n, len(buf))
+	}
+}
+
+func TestFrameHTTP1Pipelined(t *testing.T) {
+	first := "GET /one HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	second := "GET /two HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	buf := []byte(first + second)
+
+	n, ok, malformed := frameHTTP1(buf)
+	if malformed || !ok {
+		t.Fatalf("frameHTTP1(buf) = (%d, %v, %v), want a complete first message", n, ok, malformed)
+	}
+	if n != len(first) {
+		t.Fatalf("n = %d, want %d (end of the first request only)", n, len(first))
+	}
+}
+
+func TestFrameHTTP1Incomplete(t *testing.T) {
+	buf := []byte("GET / HTTP/1.1\r\nHost: example.com\r\n")
+
+	_, ok, malformed := frameHTTP1(buf)
+	if malformed {
+		t.Fatalf("frameHTTP1 reported malformed for a request that just hasn't finished arriving")
+	}
+	if ok {
+		t.Fatalf("frameHTTP1 framed a request before its headers were fully received")
+	}
+}
+
+func TestFrameHTTP1IncompleteBody(t *testing.T) {
+	buf := []byte("POST /submit HTTP/1.1\r\nHost: example.com\r\nContent-Length: 10\r\n\r\nhello")
+
+	_, ok, malformed := frameHTTP1(buf)
+	if malformed {
+		t.Fatalf("frameHTTP1 reported malformed while waiting for the rest of the body")
+	}
+	if ok {
+		t.Fatalf("frameHTTP1 framed a request before its Content-Length body arrived")
+	}
+}
+
+func TestFrameHTTP1Chunked(t *testing.T) {
+	buf := []byte("POST /submit HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"5\r\nhello\r\n0\r\nX-Trailer: done\r\n\r\n")
+
+	n, ok, malformed := frameHTTP1(buf)
+	if malformed {
+		t.Fatalf("frameHTTP1 reported malformed for a complete chunked request with a trailer")
+	}
+	if !ok {
+		t.Fatalf("frameHTTP1 did not frame a complete chunked request")
+	}
+	if n != len(buf) {
+		t.Fatalf("n = %d, want %d (whole buffer, trailer included)", n, len(buf))
+	}
+}
+
+func TestFrameHTTP1ChunkedIncomplete(t *testing.T) {
+	buf := []byte("POST /submit HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"5\r\nhel")
+
+	_, ok, malformed := frameHTTP1(buf)
+	if malformed {
+		t.Fatalf("frameHTTP1 reported malformed while a chunk is still arriving")
+	}
+	if ok {
+		t.Fatalf("frameHTTP1 framed a chunked request before its final chunk arrived")
+	}
+}
+
+func TestFrameHTTP1Response(t *testing.T) {
+	buf := []byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nhi")
+
+	n, ok, malformed := frameHTTP1(buf)
+	if malformed {
+		t.Fatalf("frameHTTP1 reported malformed for a valid response")
+	}
+	if !ok {
+		t.Fatalf("frameHTTP1 did not frame a complete response")
+	}
+	if n != len(buf) {
+		t.Fatalf("n = %d, want %d (whole buffer)", n, len(buf))
+	}
+}
+
+func TestFrameHTTP1Malformed(t *testing.T) {
+	buf := []byte("not even close to HTTP\r\n\r\n")
+
+	_, ok, malformed := frameHTTP1(buf)
+	if ok {
+		t.Fatalf("frameHTTP1 framed garbage input as a complete message")
+	}
+	if !malformed {
+		t.Fatalf("frameHTTP1 did not recognize garbage input as malformed")
+	}
+}
@@ -3,9 +3,14 @@ package raw_socket
 import (
 	"encoding/binary"
 	_ "fmt"
+	"io"
+	"log"
 	"net"
 	"os"
 	"strconv"
+	"time"
+
+	"golang.org/x/net/bpf"
 )
 
 const (
@@ -27,43 +32,165 @@ type Listener struct {
 
 	c_del_message chan *TCPMessage // Used for notifications about completed or expired messages
 
+	requests map[string][]*TCPMessage // completed requests awaiting their response, FIFO per 5-tuple
+	c_pairs  chan [2]*TCPMessage      // [request, response] pairs ready for ReceivePair
+
+	conns *connTable // per-connection sequence bookkeeping, see conn_table.go
+
 	addr string // IP to listen
 	port int    // Port to listen
+
+	// eof is set by readPcapFile once its file is exhausted; listen then
+	// closes c_messages once every in-flight TCPMessage has drained
+	// instead of immediately, so a message still being framed or timed
+	// out isn't dropped or sent on a closed channel.
+	eof bool
+
+	opts ListenerOptions
+	bpf  []bpf.Instruction // Kernel packet filter, set once in newListener, see ListenerOptions.BPF and defaultBPF
+
+	tee *PcapWriter // set by TeeToPcap; archives every accepted packet
 }
 
-// RAWTCPListen creates a listener to capture traffic from RAW_SOCKET
+// RAWTCPListen creates a listener to capture traffic from RAW_SOCKET,
+// using DefaultListenerOptions.
 func NewListener(addr string, port string) (rawListener *Listener) {
+	return NewListenerWithOptions(addr, port, DefaultListenerOptions())
+}
+
+// NewListenerWithOptions is like NewListener but lets the caller tune the
+// raw-socket reader, e.g. to enable the Linux recvmmsg(2) batched path.
+func NewListenerWithOptions(addr string, port string, opts ListenerOptions) (rawListener *Listener) {
+	rawListener = newListener(addr, port, opts)
+
+	go rawListener.listen()
+	go rawListener.readRAWSocket()
+
+	return
+}
+
+// NewPcapListener reads a libpcap file at path instead of a live raw
+// socket, walking link-layer and IP headers to hand TCP segments into the
+// same parsePacket pipeline the live Listener uses. c_messages is closed
+// once the file is exhausted, so Receive/ReceivePair callers see EOF as
+// the channel draining rather than blocking forever.
+func NewPcapListener(path string, port string) (rawListener *Listener) {
+	rawListener = newListener("", port, DefaultListenerOptions())
+
+	go rawListener.listen()
+	go rawListener.readPcapFile(path)
+
+	return
+}
+
+// newListener builds a Listener and its channels/tables without starting
+// the goroutine that feeds it packets, so NewListenerWithOptions and
+// NewPcapListener can each wire up their own source.
+func newListener(addr string, port string, opts ListenerOptions) (rawListener *Listener) {
 	rawListener = &Listener{}
 
 	rawListener.c_packets = make(chan *TCPPacket, 100)
 	rawListener.c_messages = make(chan *TCPMessage, 100)
 	rawListener.c_del_message = make(chan *TCPMessage, 100)
+	rawListener.c_pairs = make(chan [2]*TCPMessage, 100)
 	rawListener.messages = make(map[string]*TCPMessage)
+	rawListener.requests = make(map[string][]*TCPMessage)
+	rawListener.conns = newConnTable()
 
 	rawListener.addr = addr
 	rawListener.port, _ = strconv.Atoi(port)
-
-	go rawListener.listen()
-	go rawListener.readRAWSocket()
+	rawListener.opts = opts
+
+	// Set once here, before either the listen() or readRAWSocket()
+	// goroutine starts, so the reader never sees a concurrent write to
+	// t.bpf: there is no window in the public API for a caller to change
+	// it afterwards (see ListenerOptions.BPF to customize it).
+	if opts.BPF != nil {
+		rawListener.bpf = opts.BPF
+	} else {
+		rawListener.bpf = rawListener.defaultBPF()
+	}
 
 	return
 }
 
+// TeeToPcap archives every packet the Listener accepts to w in classic
+// pcap format (LinkTypeRaw), so traffic can be replayed later through
+// NewPcapListener for regression testing or debugging reassembly bugs.
+func (t *Listener) TeeToPcap(w io.Writer) {
+	t.tee = NewPcapWriter(w, LinkTypeRaw)
+}
+
 func (t *Listener) listen() {
 	for {
+		// c_del_message is drained ahead of c_packets whenever both are
+		// ready: seeding a pipelined request's leftover can itself finish
+		// synchronously (see seedLeftover/NewTCPMessageFromLeftover) and
+		// re-enter this same channel, racing an already-queued raw packet
+		// (e.g. that request's own response) for the plain select below.
+		// Go's select has no priority between ready cases, so without this
+		// the response can be processed first and find no request queued
+		// yet to pair with.
+		select {
+		case message := <-t.c_del_message:
+			t.handleCompletedMessage(message)
+			if t.eof && len(t.messages) == 0 {
+				close(t.c_messages)
+				return
+			}
+			continue
+		default:
+		}
+
 		select {
 		// If message ready for deletion it means that its also complete or expired by timeout
 		case message := <-t.c_del_message:
-			t.c_messages <- message
-			delete(t.messages, message.ID)
+			t.handleCompletedMessage(message)
+
+			if t.eof && len(t.messages) == 0 {
+				close(t.c_messages)
+				return
+			}
 
 		// We need to use channels to process each packet to avoid data races
 		case packet := <-t.c_packets:
+			if packet == nil {
+				// Sentinel from readPcapFile: the file is exhausted and no
+				// further packets will arrive on this channel. Sent through
+				// c_packets itself (rather than a separate channel) so it's
+				// ordered after every real packet already queued.
+				t.eof = true
+				if len(t.messages) == 0 {
+					close(t.c_messages)
+					return
+				}
+				continue
+			}
+
 			t.processTCPPacket(packet)
 		}
 	}
 }
 
+// handleCompletedMessage retires a completed/expired message: it's
+// forgotten, any pipelined leftover is seeded into a new message, and it's
+// paired and handed to Receive()/ReceivePair callers.
+func (t *Listener) handleCompletedMessage(message *TCPMessage) {
+	delete(t.messages, message.ID)
+
+	// Pipelined HTTP/1.1 requests can land in the same packets as the one
+	// we just framed; seed a fresh TCPMessage with the leftover bytes so
+	// they aren't dropped.
+	if len(message.leftover) > 0 {
+		t.seedLeftover(message)
+	}
+
+	// pair sets IsIncoming/UUID, so it must run before the message is
+	// handed to a Receive() caller on another goroutine.
+	t.pair(message)
+	t.c_messages <- message
+}
+
 func inet_ntoa(ipnr uint32) net.IP {
 	var bytes [4]byte
 	bytes[0] = byte(ipnr & 0xFF)
@@ -129,6 +256,13 @@ func (t *Listener) parsePacket(addr net.Addr, src_ip string, dest_ip string, buf
 		new_buf := make([]byte, len(buf))
 		copy(new_buf, buf)
 
+		if t.tee != nil {
+			ipPacket := append(synthesizeIPv4Header(net.ParseIP(src_ip), net.ParseIP(dest_ip), len(new_buf)), new_buf...)
+			if err := t.tee.WritePacket(time.Now(), ipPacket); err != nil {
+				log.Println("Error writing to pcap tee:", err)
+			}
+		}
+
 		t.c_packets <- ParseTCPPacket(addr, src_ip, dest_ip, new_buf)
 	}
 }
@@ -176,18 +310,23 @@ func (t *Listener) isHeartbeatPackage(buf []byte, dataOffset byte) bool {
 
 // Trying to add packet to existing message or creating new message
 //
-// For TCP message unique id is Acknowledgment number (see tcp_packet.go)
+// The message id is the canonical 5-tuple plus Ack, since the Addr-only
+// key used previously can't tell apart two clients whose kernels picked
+// the same initial Ack for the same server port.
 func (t *Listener) processTCPPacket(packet *TCPPacket) {
 	defer func() { recover() }()
 
+	key := connKey{packet.SrcIP, packet.SrcPort, packet.DestIP, packet.DestPort}
+	packet.StreamOffset = t.conns.Offset(key, packet)
+
 	var message *TCPMessage
-	m_id := packet.Addr.String() + strconv.Itoa(int(packet.Ack))
+	m_id := key.String() + "/" + strconv.Itoa(int(packet.Ack))
 
 	message, ok := t.messages[m_id]
 
 	if !ok {
 		// We sending c_del_message channel, so message object can communicate with Listener and notify it if message completed
-		message = NewTCPMessage(m_id, t.c_del_message)
+		message = NewTCPMessage(m_id, t.c_del_message, t.opts.Protocol)
 		t.messages[m_id] = message
 	}
 
@@ -195,7 +334,140 @@ func (t *Listener) processTCPPacket(packet *TCPPacket) {
 	message.c_packets <- packet
 }
 
+// seedLeftover starts a new TCPMessage for the bytes of a pipelined
+// request that followed immediately after one the HTTP1 framer just
+// closed out, so they aren't lost while we wait for their own packets.
+func (t *Listener) seedLeftover(prev *TCPMessage) {
+	next := NewTCPMessageFromLeftover(prev.ID, t.c_del_message, t.opts.Protocol, prev.leftoverOffset, prev.leftover,
+		prev.SourceIP(), prev.SourcePort(), prev.DestinationIP(), prev.DestinationPort())
+	t.messages[prev.ID] = next
+}
+
+// tupleKey identifies one direction of a TCP flow.
+func tupleKey(srcIP string, srcPort uint16, dstIP string, dstPort uint16) string {
+	return srcIP + ":" + strconv.Itoa(int(srcPort)) + "-" + dstIP + ":" + strconv.Itoa(int(dstPort))
+}
+
+// pair marks message with its direction and, once both sides of a flow
+// have been seen, matches a request with the response that followed it
+// on the reverse tuple so they can be delivered together via ReceivePair.
+//
+// Requests are queued FIFO per tuple rather than kept in a single slot,
+// since pipelining (chunk0-2) means a second request can complete before
+// the first gets its response.
+func (t *Listener) pair(message *TCPMessage) {
+	if len(message.packets) == 0 && !message.hasSeed {
+		return
+	}
+
+	srcIP, srcPort := message.SourceIP(), message.SourcePort()
+	dstIP, dstPort := message.DestinationIP(), message.DestinationPort()
+
+	if int(dstPort) == t.port {
+		// Traveling towards the listened port: a request. Park it until
+		// its response shows up.
+		message.IsIncoming = true
+		key := tupleKey(srcIP, srcPort, dstIP, dstPort)
+		t.requests[key] = append(t.requests[key], message)
+		return
+	}
+
+	if int(srcPort) == t.port {
+		// Traveling away from the listened port: a response. Pair it with
+		// the oldest still-unanswered request on the reverse tuple, if any.
+		key := tupleKey(dstIP, dstPort, srcIP, srcPort)
+		queue := t.requests[key]
+		if len(queue) == 0 {
+			return
+		}
+
+		req := queue[0]
+		if len(queue) == 1 {
+			delete(t.requests, key)
+		} else {
+			t.requests[key] = queue[1:]
+		}
+
+		message.UUID = req.UUID
+		message.RequestStart = req.Start
+
+		// ReceivePair has no guaranteed consumer (input_raw.go only calls
+		// Receive), so a full buffer must drop the pair instead of
+		// blocking listen() and stalling every other message with it.
+		select {
+		case t.c_pairs <- [2]*TCPMessage{req, message}:
+		default:
+			log.Println("Dropping request/response pair: ReceivePair buffer full")
+		}
+	}
+}
+
 // Receive TCP messages from the listener channel
 func (t *Listener) Receive() *TCPMessage {
 	return <-t.c_messages
 }
+
+// ReceivePair blocks until a request TCPMessage and the response that
+// followed it on the reverse 5-tuple have both been captured, then
+// returns them together for latency/replay analysis.
+func (t *Listener) ReceivePair() (request, response *TCPMessage) {
+	pair := <-t.c_pairs
+	return pair[0], pair[1]
+}
+
+// readPcapFile walks path record by record, stripping the link-layer
+// header (Ethernet) and IP header before handing the TCP segment to
+// parsePacket. On return (EOF or error) it sends a nil sentinel through
+// c_packets so listen closes c_messages only once every message already
+// queued ahead of it has drained, rather than racing them.
+func (t *Listener) readPcapFile(path string) {
+	defer func() { t.c_packets <- nil }()
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Println("Error opening pcap file:", err)
+		return
+	}
+	defer f.Close()
+
+	r, err := NewPcapReader(f)
+	if err != nil {
+		log.Println("Error reading pcap header:", err)
+		return
+	}
+
+	for {
+		buf, _, err := r.ReadPacket()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Println("Error reading pcap record:", err)
+			return
+		}
+
+		ipBuf := buf
+		if r.LinkType() == LinkTypeEthernet {
+			const etherTypeIPv4 = 0x0800
+			if len(buf) < 14 || binary.BigEndian.Uint16(buf[12:14]) != etherTypeIPv4 {
+				continue
+			}
+			ipBuf = buf[14:]
+		}
+
+		const tcpProtocol = 6
+		if len(ipBuf) < 20 || ipBuf[0]>>4 != 4 || ipBuf[9] != tcpProtocol {
+			continue
+		}
+
+		ihl := int(ipBuf[0]&0x0f) << 2
+		if ihl < 20 || ihl > len(ipBuf) {
+			continue
+		}
+
+		srcIP := net.IP(ipBuf[12:16]).String()
+		dstIP := net.IP(ipBuf[16:20]).String()
+
+		t.parsePacket(&net.IPAddr{IP: net.ParseIP(srcIP)}, srcIP, dstIP, ipBuf[ihl:])
+	}
+}
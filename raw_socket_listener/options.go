@@ -0,0 +1,39 @@
+package raw_socket
+
+import "golang.org/x/net/bpf"
+
+// ListenerOptions configures how a Listener reads packets off the wire.
+type ListenerOptions struct {
+	// BatchSize is the number of packets requested per recvmmsg(2) call.
+	// Ignored unless UseRecvmmsg is true.
+	BatchSize int
+
+	// RcvBufBytes sets SO_RCVBUF on the raw socket. Zero leaves the OS default.
+	RcvBufBytes int
+
+	// UseRecvmmsg enables the Linux recvmmsg(2) batched reader. Ignored
+	// (treated as false) on platforms without a batched implementation.
+	UseRecvmmsg bool
+
+	// Protocol selects how a message is considered complete. ProtocolRaw
+	// preserves the original MSG_EXPIRE-only behavior.
+	Protocol Protocol
+
+	// BPF overrides the kernel packet filter attached to the raw socket,
+	// e.g. to restrict capture to a source subnet on top of the default
+	// port/heartbeat filter. Set this instead of mutating a Listener's
+	// filter after construction: both reader goroutines start as soon as
+	// NewListenerWithOptions/NewPcapListener return, so there is no safe
+	// window to change it afterwards. Nil uses defaultBPF().
+	BPF []bpf.Instruction
+}
+
+// DefaultListenerOptions returns the options used by NewListener.
+func DefaultListenerOptions() ListenerOptions {
+	return ListenerOptions{
+		BatchSize:   1024,
+		RcvBufBytes: 4 << 20,
+		UseRecvmmsg: true,
+		Protocol:    ProtocolHTTP1,
+	}
+}
@@ -0,0 +1,21 @@
+package raw_socket
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// Payload type markers for PayloadHeader, following the framing goreplay's
+// payloadHeader uses: a type byte, a UUID, and a monotonic timestamp ahead
+// of every message body.
+const (
+	RequestPayload  byte = '1'
+	ResponsePayload byte = '2'
+)
+
+// PayloadHeader returns the framed header written ahead of a message body:
+// payload type, hex-encoded UUID, and a timestamp in nanoseconds, newline
+// terminated so callers can split header from body on the first '\n'.
+func PayloadHeader(payloadType byte, uuid []byte, timestampNs int64) []byte {
+	return []byte(fmt.Sprintf("%c %s %d\n", payloadType, hex.EncodeToString(uuid), timestampNs))
+}
@@ -0,0 +1,145 @@
+package raw_socket
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Self-contained libpcap reader/writer: 24-byte global header, 16-byte
+// per-record header, little-endian. This is the classic pcap format (not
+// pcap-ng), which is all NewPcapListener/TeeToPcap need and avoids pulling
+// in a full packet-capture library.
+const (
+	pcapMagicLittleEndian = 0xa1b2c3d4
+	pcapVersionMajor      = 2
+	pcapVersionMinor      = 4
+	pcapSnapLen           = 65535
+
+	// LinkTypeEthernet and LinkTypeRaw are the two link-layer types
+	// NewPcapListener understands: a 14-byte Ethernet header in front of
+	// the IP packet (what tcpdump/wireshark normally write), or the IP
+	// packet with no link-layer header at all (what TeeToPcap writes).
+	LinkTypeEthernet = 1
+	LinkTypeRaw      = 101
+)
+
+type pcapGlobalHeader struct {
+	MagicNumber  uint32
+	VersionMajor uint16
+	VersionMinor uint16
+	ThisZone     int32
+	SigFigs      uint32
+	SnapLen      uint32
+	Network      uint32
+}
+
+type pcapRecordHeader struct {
+	TsSec   uint32
+	TsUsec  uint32
+	InclLen uint32
+	OrigLen uint32
+}
+
+// PcapWriter appends packets to an io.Writer in classic pcap format,
+// writing the global header before the first record.
+type PcapWriter struct {
+	w        io.Writer
+	linkType uint32
+	wroteHdr bool
+}
+
+// NewPcapWriter returns a PcapWriter for the given link type (LinkTypeRaw
+// or LinkTypeEthernet).
+func NewPcapWriter(w io.Writer, linkType uint32) *PcapWriter {
+	return &PcapWriter{w: w, linkType: linkType}
+}
+
+// WritePacket appends one record. data is an entire link-layer frame (or,
+// for LinkTypeRaw, an entire IP packet).
+func (p *PcapWriter) WritePacket(t time.Time, data []byte) error {
+	if !p.wroteHdr {
+		if err := binary.Write(p.w, binary.LittleEndian, pcapGlobalHeader{
+			MagicNumber:  pcapMagicLittleEndian,
+			VersionMajor: pcapVersionMajor,
+			VersionMinor: pcapVersionMinor,
+			SnapLen:      pcapSnapLen,
+			Network:      p.linkType,
+		}); err != nil {
+			return err
+		}
+		p.wroteHdr = true
+	}
+
+	hdr := pcapRecordHeader{
+		TsSec:   uint32(t.Unix()),
+		TsUsec:  uint32(t.Nanosecond() / 1000),
+		InclLen: uint32(len(data)),
+		OrigLen: uint32(len(data)),
+	}
+	if err := binary.Write(p.w, binary.LittleEndian, hdr); err != nil {
+		return err
+	}
+
+	_, err := p.w.Write(data)
+	return err
+}
+
+// PcapReader reads packets back out of a classic pcap stream.
+type PcapReader struct {
+	r        io.Reader
+	linkType uint32
+}
+
+// NewPcapReader reads the global header off r and returns a PcapReader
+// for the records that follow.
+func NewPcapReader(r io.Reader) (*PcapReader, error) {
+	var hdr pcapGlobalHeader
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.MagicNumber != pcapMagicLittleEndian {
+		return nil, fmt.Errorf("raw_socket: not a little-endian pcap file (magic %#x)", hdr.MagicNumber)
+	}
+
+	return &PcapReader{r: r, linkType: hdr.Network}, nil
+}
+
+// LinkType is the Network field from the file's global header.
+func (p *PcapReader) LinkType() uint32 {
+	return p.linkType
+}
+
+// ReadPacket returns the next record's bytes and capture time, or io.EOF
+// once the stream is exhausted.
+func (p *PcapReader) ReadPacket() ([]byte, time.Time, error) {
+	var hdr pcapRecordHeader
+	if err := binary.Read(p.r, binary.LittleEndian, &hdr); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	buf := make([]byte, hdr.InclLen)
+	if _, err := io.ReadFull(p.r, buf); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return buf, time.Unix(int64(hdr.TsSec), int64(hdr.TsUsec)*1000), nil
+}
+
+// synthesizeIPv4Header builds a minimal 20-byte IPv4 header (no options,
+// no checksum) so a TCP segment captured past the IP layer can still be
+// archived as a standalone, replayable IP packet. Checksums are left
+// zeroed; readers of the offline path don't verify them.
+func synthesizeIPv4Header(srcIP, dstIP net.IP, payloadLen int) []byte {
+	hdr := make([]byte, 20)
+	hdr[0] = 0x45 // version 4, 20-byte header
+	binary.BigEndian.PutUint16(hdr[2:4], uint16(20+payloadLen))
+	hdr[8] = 64 // TTL
+	hdr[9] = 6  // protocol: TCP
+	copy(hdr[12:16], srcIP.To4())
+	copy(hdr[16:20], dstIP.To4())
+
+	return hdr
+}
@@ -0,0 +1,39 @@
+package raw_socket
+
+import (
+	"log"
+	"net"
+)
+
+// readRAWSocketSingle issues one recvfrom(2) per packet via a raw IP socket.
+// It is the baseline implementation used on every platform, and the
+// fallback path on Linux when UseRecvmmsg is false (see reader_linux.go).
+func (t *Listener) readRAWSocketSingle() {
+	conn, err := net.ListenIP("ip4:tcp", &net.IPAddr{IP: net.ParseIP(t.addr)})
+	if err != nil {
+		log.Println("Error while creating raw socket:", err)
+		return
+	}
+	defer conn.Close()
+
+	if len(t.bpf) > 0 {
+		if raw, err := conn.SyscallConn(); err == nil {
+			raw.Control(func(fd uintptr) {
+				if err := attachBPF(int(fd), t.bpf); err != nil {
+					log.Println("Error attaching BPF filter:", err)
+				}
+			})
+		}
+	}
+
+	buf := make([]byte, 64*1024)
+
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			continue
+		}
+
+		t.parsePacket(addr, addr.String(), t.addr, buf[:n])
+	}
+}
@@ -0,0 +1,110 @@
+//go:build linux
+// +build linux
+
+package raw_socket
+
+import (
+	"log"
+	"net"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// mmsghdr mirrors the kernel's struct mmsghdr used by recvmmsg(2), letting us
+// pull many packets into one syscall instead of one recvfrom per packet.
+type mmsghdr struct {
+	Hdr unix.Msghdr
+	Len uint32
+}
+
+// readRAWSocket picks the batched recvmmsg(2) reader when t.opts.UseRecvmmsg
+// is set, and falls back to the portable single-recv path otherwise.
+func (t *Listener) readRAWSocket() {
+	if !t.opts.UseRecvmmsg {
+		t.readRAWSocketSingle()
+		return
+	}
+
+	if err := t.readRAWSocketBatch(); err != nil {
+		log.Println("recvmmsg unavailable, falling back to single-packet reads:", err)
+		t.readRAWSocketSingle()
+	}
+}
+
+// readRAWSocketBatch pulls up to t.opts.BatchSize packets per recvmmsg(2)
+// call into a reusable []mmsghdr/[]iovec pool and hands each payload to
+// parsePacket without allocating on the hot path. The receive buffers are
+// reused across syscalls, so parsePacket must copy the bytes it keeps
+// before the next recvmmsg call overwrites them.
+func (t *Listener) readRAWSocketBatch() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_RAW, unix.IPPROTO_TCP)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	// readRAWSocketSingle binds via net.ListenIP; recvmmsg needs the same
+	// restriction or it captures every local address on a multi-homed host.
+	var bindAddr [4]byte
+	copy(bindAddr[:], net.ParseIP(t.addr).To4())
+	if err := unix.Bind(fd, &unix.SockaddrInet4{Addr: bindAddr}); err != nil {
+		return err
+	}
+
+	if t.opts.RcvBufBytes > 0 {
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, t.opts.RcvBufBytes); err != nil {
+			log.Println("Error setting SO_RCVBUF:", err)
+		}
+	}
+
+	if len(t.bpf) > 0 {
+		if err := attachBPF(fd, t.bpf); err != nil {
+			log.Println("Error attaching BPF filter:", err)
+		}
+	}
+
+	batch := t.opts.BatchSize
+	if batch <= 0 {
+		batch = 1
+	}
+
+	const mtu = 65536
+	bufs := make([][]byte, batch)
+	iovecs := make([]unix.Iovec, batch)
+	msgs := make([]mmsghdr, batch)
+	names := make([]unix.RawSockaddrInet4, batch)
+
+	for i := range bufs {
+		bufs[i] = make([]byte, mtu)
+		iovecs[i].Base = &bufs[i][0]
+		iovecs[i].SetLen(mtu)
+
+		msgs[i].Hdr.Iov = &iovecs[i]
+		msgs[i].Hdr.Iovlen = 1
+		msgs[i].Hdr.Name = (*byte)(unsafe.Pointer(&names[i]))
+		msgs[i].Hdr.Namelen = uint32(unsafe.Sizeof(names[i]))
+	}
+
+	for {
+		n, _, errno := unix.Syscall6(unix.SYS_RECVMMSG, uintptr(fd),
+			uintptr(unsafe.Pointer(&msgs[0])), uintptr(batch), 0, 0, 0)
+		if errno != 0 {
+			return errno
+		}
+
+		for i := 0; i < int(n); i++ {
+			a := names[i].Addr
+			srcIP := net.IPv4(a[0], a[1], a[2], a[3]).String()
+
+			// IPPROTO_TCP raw sockets deliver the full IP datagram, header
+			// included; readRAWSocketSingle gets the TCP-only payload for
+			// free via net.ListenIP (which strips it internally), so the
+			// batched path has to do the same before parsePacket, which
+			// assumes buf starts at the TCP header.
+			buf := bufs[i][:msgs[i].Len]
+			tcpLen := stripIPv4Header(len(buf), buf)
+			t.parsePacket(&net.IPAddr{IP: net.ParseIP(srcIP)}, srcIP, t.addr, buf[:tcpLen])
+		}
+	}
+}
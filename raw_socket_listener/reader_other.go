@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package raw_socket
+
+// readRAWSocket is the single-packet reader used on platforms without a
+// recvmmsg(2) batched implementation (see reader_linux.go).
+func (t *Listener) readRAWSocket() {
+	t.readRAWSocketSingle()
+}
@@ -2,6 +2,7 @@ package raw_socket
 
 import (
 	"sort"
+	"sync"
 	"time"
 )
 
@@ -22,14 +23,76 @@ type TCPMessage struct {
 	c_packets chan *TCPPacket
 
 	c_del_message chan *TCPMessage
+
+	doneOnce sync.Once // guards against Timeout and tryFrameHTTP1 both finishing the message
+
+	protocol       Protocol // How to detect message completion
+	framed         bool     // true once the HTTP1 framer has found the end of the message
+	frameLen       int      // Bytes() clips to this many bytes once framed is true
+	leftover       []byte   // bytes after the framed message: the start of the next pipelined request
+	leftoverOffset uint64   // Stream offset the leftover bytes start at
+
+	seedOffset uint64 // Stream offset of seedBytes, set when this message was started from another's leftover
+	seedBytes  []byte
+	hasSeed    bool
+
+	// seedSrcIP/seedSrcPort/seedDestIP/seedDestPort carry over the 5-tuple
+	// of the message this one was seeded from, so SourceIP/SourcePort/
+	// DestinationIP/DestinationPort still report it correctly if this
+	// message completes from seedBytes alone, before any packet of its
+	// own arrives.
+	seedSrcIP    string
+	seedSrcPort  uint16
+	seedDestIP   string
+	seedDestPort uint16
+
+	// IsIncoming is true for a message flowing towards the listened port
+	// (a request), false for one flowing away from it (a response). Set
+	// once the Listener knows the message's direction.
+	IsIncoming bool
+
+	// UUID identifies this message, and is shared with its paired
+	// request/response (see Listener.ReceivePair).
+	UUID []byte
+
+	Start        time.Time // Time the first packet of this message was captured
+	End          time.Time // Time the last packet of this message was captured
+	RequestStart time.Time // On a response, Start of the request it was paired with
+}
+
+// NewTCPMessageFromLeftover seeds a TCPMessage with the bytes of a
+// pipelined request that arrived in the same packets as one the HTTP1
+// framer just closed out. srcIP/srcPort/destIP/destPort are the 5-tuple
+// of the message it was seeded from, which flows in the same direction.
+//
+// If the leftover bytes already form a complete HTTP/1.x message on
+// their own, this frames and hands it off immediately instead of
+// waiting for a packet of its own (or MSG_EXPIRE) to trigger it.
+func NewTCPMessageFromLeftover(ID string, c_del chan *TCPMessage, protocol Protocol, offset uint64, leftover []byte, srcIP string, srcPort uint16, destIP string, destPort uint16) (msg *TCPMessage) {
+	msg = NewTCPMessage(ID, c_del, protocol)
+	msg.seedOffset = offset
+	msg.seedBytes = leftover
+	msg.hasSeed = true
+	msg.seedSrcIP = srcIP
+	msg.seedSrcPort = srcPort
+	msg.seedDestIP = destIP
+	msg.seedDestPort = destPort
+	msg.Start = time.Now()
+
+	if msg.protocol == ProtocolHTTP1 {
+		msg.tryFrameHTTP1()
+	}
+
+	return
 }
 
 // NewTCPMessage pointer created from a Acknowledgment number and a channel of messages readuy to be deleted
-func NewTCPMessage(ID string, c_del chan *TCPMessage) (msg *TCPMessage) {
-	msg = &TCPMessage{ID: ID}
+func NewTCPMessage(ID string, c_del chan *TCPMessage, protocol Protocol) (msg *TCPMessage) {
+	msg = &TCPMessage{ID: ID, protocol: protocol}
 
 	msg.c_packets = make(chan *TCPPacket)
 	msg.c_del_message = c_del // used for notifying that message completed or expired
+	msg.UUID = newUUID()
 
 	// Every time we receive packet we reset this timer
 	msg.timer = time.AfterFunc(MSG_EXPIRE, msg.Timeout)
@@ -65,17 +128,38 @@ func (t *TCPMessage) Timeout() {
 			return
 		}
 	default:
+		t.finish()
+	}
+}
+
+// finish closes c_packets and notifies the Listener that the message is
+// ready to be sent, exactly once. Timeout and tryFrameHTTP1 both reach
+// this: stopping t.timer doesn't prevent an already-running Timeout from
+// completing (see time.AfterFunc), so the two can race to finish the same
+// message and must share this guard rather than closing the channel
+// directly.
+func (t *TCPMessage) finish() {
+	t.doneOnce.Do(func() {
 		close(t.c_packets)
 		t.c_del_message <- t // Notify RAWListener that message is ready to be send to replay server
-	}
+	})
 }
 
-// Bytes sorts packets in right orders and return message content
+// Bytes orders packets by absolute stream offset (not the wrapping Seq)
+// and returns the message content. Once the HTTP1 framer has found the
+// end of the message, this is clipped to frameLen so that trailing bytes
+// of a pipelined request (held in the next message's seedBytes instead)
+// aren't duplicated here.
 func (t *TCPMessage) Bytes() (output []byte) {
-	sort.Sort(BySeq(t.packets))
+	sort.Sort(ByOffset(t.packets))
 
+	output = append(output, t.seedBytes...)
 	for _, v := range t.packets {
-		output = append(output, v.tcp.Payload...)
+		output = append(output, v.Data...)
+	}
+
+	if t.framed && len(output) > t.frameLen {
+		output = output[:t.frameLen]
 	}
 
 	return
@@ -83,7 +167,9 @@ func (t *TCPMessage) Bytes() (output []byte) {
 
 func (t *TCPMessage) SourcePort() uint16 {
 	if len(t.packets) > 0 {
-		return uint16(t.packets[0].tcp.SrcPort)
+		return t.packets[0].SrcPort
+	} else if t.hasSeed {
+		return t.seedSrcPort
 	} else {
 		return 0
 	}
@@ -91,7 +177,9 @@ func (t *TCPMessage) SourcePort() uint16 {
 
 func (t *TCPMessage) DestinationPort() uint16 {
 	if len(t.packets) > 0 {
-		return uint16(t.packets[0].tcp.DstPort)
+		return t.packets[0].DestPort
+	} else if t.hasSeed {
+		return t.seedDestPort
 	} else {
 		return 0
 	}
@@ -100,6 +188,8 @@ func (t *TCPMessage) DestinationPort() uint16 {
 func (t *TCPMessage) SourceIP() string {
 	if len(t.packets) > 0 {
 		return t.packets[0].SrcIP
+	} else if t.hasSeed {
+		return t.seedSrcIP
 	} else {
 		return "0.0.0.0"
 	}
@@ -108,39 +198,135 @@ func (t *TCPMessage) SourceIP() string {
 func (t *TCPMessage) DestinationIP() string {
 	if len(t.packets) > 0 {
 		return t.packets[0].DestIP
+	} else if t.hasSeed {
+		return t.seedDestIP
 	} else {
 		return "0.0.0.0"
 	}
 }
 
 func (t *TCPMessage) SequenceNumber() uint32 {
-	sort.Sort(BySeq(t.packets))
+	sort.Sort(ByOffset(t.packets))
 
 	if len(t.packets) > 0 {
-		return t.packets[0].tcp.Seq
+		return t.packets[0].Seq
 	} else {
 		return 0
 	}
 }
 
 // AddPacket to the message and ensure packet uniqueness
-// TCP allows that packet can be re-send multiple times
+//
+// Packets are identified by their absolute stream offset rather than the
+// raw (wrapping) Seq. A retransmission at the same offset with the same
+// length is a true duplicate and dropped; one carrying more data (e.g. a
+// larger segment on retry) replaces what we had instead of being
+// silently dropped.
 func (t *TCPMessage) AddPacket(packet *TCPPacket) {
-	packetFound := false
+	for i, pkt := range t.packets {
+		if packet.StreamOffset != pkt.StreamOffset {
+			continue
+		}
 
-	for _, pkt := range t.packets {
-		if packet.tcp.Seq == pkt.tcp.Seq {
-			packetFound = true
-			break
+		if len(packet.Data) <= len(pkt.Data) {
+			//log.Println("Received packet with same sequence")
+			t.timer.Reset(MSG_EXPIRE)
+			return
 		}
+
+		t.packets[i] = packet
+		t.onPacketAdded(packet)
+		return
 	}
 
-	if packetFound {
-		//log.Println("Received packet with same sequence")
-	} else {
-		t.packets = append(t.packets, packet)
+	t.packets = append(t.packets, packet)
+	t.onPacketAdded(packet)
+}
+
+// onPacketAdded resets the expire timer, tracks Start/End, and re-attempts
+// HTTP1 framing after a packet has been added or has replaced another.
+func (t *TCPMessage) onPacketAdded(packet *TCPPacket) {
+	if t.Start.IsZero() {
+		t.Start = packet.Timestamp
 	}
+	t.End = packet.Timestamp
 
 	// Reset message timeout timer
 	t.timer.Reset(MSG_EXPIRE)
+
+	if t.protocol == ProtocolHTTP1 && !t.framed {
+		t.tryFrameHTTP1()
+	}
+}
+
+// tryFrameHTTP1 checks whether the contiguous byte stream starting at the
+// first packet's stream offset now contains one complete HTTP/1.x
+// message. If so it fires c_del_message immediately instead of waiting
+// for MSG_EXPIRE, and stashes any trailing bytes belonging to the next
+// pipelined request in t.leftover for the Listener to seed into a new
+// TCPMessage.
+//
+// If the stream can never be HTTP/1.x, it falls back to ProtocolRaw so the
+// timer decides completion as before.
+func (t *TCPMessage) tryFrameHTTP1() {
+	buf := t.contiguousBytes()
+	if len(buf) == 0 {
+		return
+	}
+
+	n, ok, malformed := frameHTTP1(buf)
+	if malformed {
+		t.protocol = ProtocolRaw
+		return
+	}
+	if !ok {
+		return
+	}
+
+	t.framed = true
+	t.frameLen = n
+	if n < len(buf) {
+		t.leftover = append([]byte(nil), buf[n:]...)
+		t.leftoverOffset = t.firstOffset() + uint64(n)
+	}
+	t.timer.Stop()
+	t.finish()
+}
+
+// contiguousBytes returns the payload of the sorted packets that form an
+// unbroken run starting at the first stream offset (or the seed bytes,
+// for a message started from another message's leftover), i.e. the
+// prefix AddPacket has extended so far with no gaps.
+func (t *TCPMessage) contiguousBytes() (out []byte) {
+	sort.Sort(ByOffset(t.packets))
+
+	next := t.firstOffset()
+	out = append(out, t.seedBytes...)
+
+	for i, p := range t.packets {
+		if !t.hasSeed && i == 0 {
+			next = p.StreamOffset
+		} else if p.StreamOffset != next {
+			break
+		}
+
+		out = append(out, p.Data...)
+		next += uint64(len(p.Data))
+	}
+
+	return out
+}
+
+// firstOffset returns the stream offset the message's byte stream starts
+// at: the seed offset if this message was started from another message's
+// leftover, otherwise the first sorted packet's offset.
+func (t *TCPMessage) firstOffset() uint64 {
+	if t.hasSeed {
+		return t.seedOffset
+	}
+	if len(t.packets) > 0 {
+		return t.packets[0].StreamOffset
+	}
+
+	return 0
 }
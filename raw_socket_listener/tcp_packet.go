@@ -5,6 +5,7 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // TCP Flags
@@ -39,6 +40,13 @@ type TCPPacket struct {
 	Addr   net.Addr
 	SrcIP  string
 	DestIP string
+
+	Timestamp time.Time // Time the packet was captured
+
+	// StreamOffset is this packet's position in its connection's byte
+	// stream, as tracked by connTable. Unlike Seq it never wraps, so it's
+	// what TCPMessage orders and deduplicates packets by.
+	StreamOffset uint64
 }
 
 func ParseTCPPacket(addr net.Addr, src_ip string, dest_ip string, b []byte) (p *TCPPacket) {
@@ -47,6 +55,7 @@ func ParseTCPPacket(addr net.Addr, src_ip string, dest_ip string, b []byte) (p *
 	p.Addr = addr
 	p.SrcIP = src_ip
 	p.DestIP = dest_ip
+	p.Timestamp = time.Now()
 
 	return p
 }
@@ -104,3 +113,11 @@ type BySeq []*TCPPacket
 func (a BySeq) Len() int           { return len(a) }
 func (a BySeq) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a BySeq) Less(i, j int) bool { return a[i].Seq < a[j].Seq }
+
+// ByOffset sorts packets by their absolute StreamOffset, which unlike Seq
+// doesn't wrap, so it's safe to use across a long-lived connection.
+type ByOffset []*TCPPacket
+
+func (a ByOffset) Len() int           { return len(a) }
+func (a ByOffset) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a ByOffset) Less(i, j int) bool { return a[i].StreamOffset < a[j].StreamOffset }
@@ -0,0 +1,11 @@
+package raw_socket
+
+import "crypto/rand"
+
+// newUUID returns a 16-byte random identifier used to correlate a
+// request TCPMessage with its paired response.
+func newUUID() []byte {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return id
+}